@@ -0,0 +1,67 @@
+package cloudfoundry
+
+import (
+	"crypto/tls"
+
+	"code.cloudfoundry.org/lager"
+	noaa "github.com/cloudfoundry/noaa/consumer"
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+// FirehoseClient subscribes to the CF Loggregator Firehose and streams
+// envelopes to a caller-supplied handler. It wraps the noaa consumer so
+// callers don't need to know about the underlying websocket transport.
+type FirehoseClient interface {
+	Subscribe(subscriptionID string, handler func(*events.Envelope), errs chan<- error) (stop func())
+}
+
+type firehoseClient struct {
+	client Client
+	logger lager.Logger
+}
+
+// NewFirehoseClient returns a FirehoseClient that authenticates against the
+// same UAA token source as the REST API client.
+func NewFirehoseClient(client Client, logger lager.Logger) FirehoseClient {
+	return &firehoseClient{
+		client: client,
+		logger: logger.Session("firehose-client"),
+	}
+}
+
+func (f *firehoseClient) Subscribe(subscriptionID string, handler func(*events.Envelope), errs chan<- error) func() {
+	consumer := noaa.New(f.client.DopplerEndpoint(), &tls.Config{InsecureSkipVerify: f.client.SkipSSLValidation()}, nil)
+	consumer.SetDebugPrinter(lagerDebugPrinter{f.logger})
+
+	msgs := make(chan *events.Envelope)
+	consumerErrs := make(chan error)
+
+	go consumer.Firehose(subscriptionID, f.client.Token(), msgs, consumerErrs, nil)
+
+	go func() {
+		for err := range consumerErrs {
+			errs <- err
+		}
+	}()
+
+	go func() {
+		for msg := range msgs {
+			handler(msg)
+		}
+	}()
+
+	return func() {
+		f.logger.Info("closing-firehose-subscription")
+		if err := consumer.Close(); err != nil {
+			f.logger.Error("close-firehose-subscription", err)
+		}
+	}
+}
+
+type lagerDebugPrinter struct {
+	logger lager.Logger
+}
+
+func (l lagerDebugPrinter) Print(title, dump string) {
+	l.logger.Debug(title, lager.Data{"dump": dump})
+}
@@ -0,0 +1,60 @@
+// Package cloudfoundry adapts the Cloud Foundry usage events APIs to
+// collector.EventFetcher.
+package cloudfoundry
+
+import (
+	"context"
+
+	"github.com/alphagov/paas-billing/db"
+)
+
+// UsageEventsAPI fetches CF usage events. cloudfoundry.NewAppUsageEventsAPI
+// and cloudfoundry.NewServiceUsageEventsAPI implement it against the two
+// usage events endpoints, tracking their own last-seen cursor between
+// calls.
+type UsageEventsAPI interface {
+	Name() string
+	FetchEvents(ctx context.Context) ([]db.RawUsageEvent, error)
+}
+
+// Store is the persistence contract EventFetcher needs; db.PostgresClient
+// satisfies it.
+type Store interface {
+	InsertUsageEvent(ctx context.Context, event db.RawUsageEvent) error
+}
+
+// EventFetcher fetches one page of usage events from api and writes them
+// to store, implementing collector.EventFetcher.
+type EventFetcher struct {
+	store Store
+	api   UsageEventsAPI
+}
+
+// NewEventFetcher returns an EventFetcher that polls api and writes
+// through store.
+func NewEventFetcher(store Store, api UsageEventsAPI) *EventFetcher {
+	return &EventFetcher{store: store, api: api}
+}
+
+// Name identifies which usage events API this fetcher polls, used to label
+// the collector metrics in package instrumentation.
+func (f *EventFetcher) Name() string {
+	return f.api.Name()
+}
+
+// FetchEvents fetches and stores one page of events, returning how many
+// rows it wrote.
+func (f *EventFetcher) FetchEvents(ctx context.Context) (int, error) {
+	events, err := f.api.FetchEvents(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		if err := f.store.InsertUsageEvent(ctx, event); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(events), nil
+}
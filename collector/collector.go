@@ -0,0 +1,63 @@
+// Package collector drives an EventFetcher on a fixed poll interval.
+// collector/firehose is the event-driven alternative to this poller.
+package collector
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/alphagov/paas-billing/instrumentation"
+)
+
+// EventFetcher fetches and stores one batch of usage events, returning how
+// many rows it wrote. collector/cloudfoundry.EventFetcher implements this
+// against the CF app/service usage events APIs.
+type EventFetcher interface {
+	Name() string
+	FetchEvents(ctx context.Context) (int, error)
+}
+
+// Collector polls an EventFetcher on a fixed interval until its context is
+// cancelled.
+type Collector struct {
+	config  Config
+	logger  lager.Logger
+	fetcher EventFetcher
+}
+
+// New returns a Collector that polls fetcher every config.PollInterval.
+func New(config Config, logger lager.Logger, fetcher EventFetcher) *Collector {
+	return &Collector{
+		config:  config,
+		logger:  logger.Session("collector", lager.Data{"fetcher": fetcher.Name()}),
+		fetcher: fetcher,
+	}
+}
+
+// Run polls the fetcher until ctx is cancelled, recording each poll as a
+// CollectorIterations tick, the rows it wrote as EventsFetched, and the
+// round-trip time as a DBWriteLatency observation.
+func (c *Collector) Run(ctx context.Context) {
+	for {
+		instrumentation.CollectorIterations.WithLabelValues(c.fetcher.Name()).Inc()
+
+		var n int
+		err := instrumentation.ObserveDBWrite(c.fetcher.Name(), func() error {
+			var fetchErr error
+			n, fetchErr = c.fetcher.FetchEvents(ctx)
+			return fetchErr
+		})
+		if err != nil {
+			c.logger.Error("fetch-events", err)
+		} else if n > 0 {
+			instrumentation.EventsFetched.WithLabelValues(c.fetcher.Name()).Add(float64(n))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.config.PollInterval):
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package collector
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config controls how often a Collector polls its EventFetcher.
+type Config struct {
+	PollInterval time.Duration
+}
+
+// CreateConfigFromEnv builds a Config from COLLECTOR_POLL_INTERVAL, the
+// number of seconds between polls (default 15).
+func CreateConfigFromEnv() (Config, error) {
+	interval := 15 * time.Second
+	if raw := os.Getenv("COLLECTOR_POLL_INTERVAL"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil {
+			return Config{}, errors.Wrap(err, "invalid COLLECTOR_POLL_INTERVAL")
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	return Config{PollInterval: interval}, nil
+}
@@ -0,0 +1,246 @@
+package firehose
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/alphagov/paas-billing/cloudfoundry"
+	"github.com/alphagov/paas-billing/db"
+	"github.com/alphagov/paas-billing/instrumentation"
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+const metricName = "firehose"
+
+// checkpointPrefix namespaces this collector's per-resource progress
+// markers in the checkpoints table, distinct from the polling collectors'
+// cursors.
+const checkpointPrefix = "firehose"
+
+// Store is the persistence contract the firehose collector needs. It is
+// satisfied by db.PostgresClient and mirrors the row shape written by the
+// polling collector_cf.EventFetcher so both paths feed the same views.
+// GetCheckpoint/SetCheckpoint are keyed per resource (see checkpointKey),
+// not by a single collector-wide key.
+type Store interface {
+	InsertUsageEvent(ctx context.Context, event db.RawUsageEvent) error
+	GetCheckpoint(ctx context.Context, key string) (time.Time, error)
+	SetCheckpoint(ctx context.Context, key string, at time.Time) error
+}
+
+// Collector subscribes to the CF Loggregator Firehose and persists the
+// envelopes it cares about (ContainerMetric and service lifecycle
+// ValueMetric envelopes) using the same store the polling collectors use.
+type Collector struct {
+	config Config
+	logger lager.Logger
+	client cloudfoundry.FirehoseClient
+	store  Store
+
+	mu          sync.Mutex
+	checkpoints map[string]resourceCheckpoint
+}
+
+// resourceCheckpoint is the highest envelope timestamp seen for one
+// resource, and whether it's been loaded from the store yet this run.
+type resourceCheckpoint struct {
+	at     time.Time
+	loaded bool
+}
+
+// New returns a firehose-backed collector. Unlike collector.New (which
+// drives a fixed poll interval), the firehose collector is event driven and
+// manages its own reconnect/backoff loop in Run.
+func New(config Config, logger lager.Logger, client cloudfoundry.FirehoseClient, store Store) *Collector {
+	return &Collector{
+		config:      config,
+		logger:      logger.Session("firehose-collector"),
+		client:      client,
+		store:       store,
+		checkpoints: make(map[string]resourceCheckpoint),
+	}
+}
+
+// Run subscribes to the firehose and blocks until ctx is cancelled,
+// reconnecting with exponential backoff only when the subscription
+// actually errors out (a healthy subscription is left alone). It resumes
+// from the highest envelope timestamp previously checkpointed per
+// resource, so neither a process restart nor a reconnect drops or
+// double-counts billable time.
+func (c *Collector) Run(ctx context.Context) error {
+	backoff := c.config.MinBackoff
+
+	for {
+		instrumentation.CollectorIterations.WithLabelValues(metricName).Inc()
+
+		wasHealthy, err := c.subscribeOnce(ctx)
+		if err != nil {
+			instrumentation.FirehoseReconnects.Inc()
+			c.logger.Error("firehose-subscription-failed", err, lager.Data{"backoff": backoff.String()})
+		}
+
+		if wasHealthy {
+			backoff = c.config.MinBackoff
+		} else {
+			backoff *= 2
+			if backoff > c.config.MaxBackoff {
+				backoff = c.config.MaxBackoff
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// subscribeOnce holds a single firehose subscription open until ctx is
+// cancelled or it errors out. wasHealthy reports whether the subscription
+// stayed up for at least the "healthy" threshold, which Run uses to decide
+// whether to reset the backoff instead of growing it further.
+func (c *Collector) subscribeOnce(ctx context.Context) (wasHealthy bool, err error) {
+	errs := make(chan error, 1)
+
+	stop := c.client.Subscribe(c.config.SubscriptionID, func(envelope *events.Envelope) {
+		c.handleEnvelope(ctx, envelope)
+	}, errs)
+	defer stop()
+
+	healthyTimer := time.NewTimer(c.config.MinBackoff * 2)
+	defer healthyTimer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return wasHealthy, nil
+		case err := <-errs:
+			return wasHealthy, err
+		case <-healthyTimer.C:
+			wasHealthy = true
+		}
+	}
+}
+
+func (c *Collector) handleEnvelope(ctx context.Context, envelope *events.Envelope) {
+	row, ok := convertEnvelope(envelope)
+	if !ok {
+		return
+	}
+
+	key := checkpointKey(row)
+
+	checkpoint, err := c.checkpointFor(ctx, key)
+	if err != nil {
+		c.logger.Error("get-checkpoint", err, lager.Data{"key": key})
+	}
+
+	if !row.CreatedAt.After(checkpoint) {
+		// Already accounted for: apps and services across the foundation
+		// emit envelopes independently, so this only rules out an envelope
+		// we've genuinely already checkpointed for this exact resource, not
+		// merely an out-of-order delivery from a different one.
+		return
+	}
+
+	err = instrumentation.ObserveDBWrite("insert_usage_event", func() error {
+		return c.store.InsertUsageEvent(ctx, row)
+	})
+	if err != nil {
+		c.logger.Error("insert-usage-event", err)
+		return
+	}
+	instrumentation.EventsFetched.WithLabelValues(metricName).Inc()
+
+	c.setCheckpoint(key, row.CreatedAt)
+	if err := c.store.SetCheckpoint(ctx, key, row.CreatedAt); err != nil {
+		c.logger.Error("set-checkpoint", err, lager.Data{"key": key})
+	}
+}
+
+// checkpointKey scopes a checkpoint to one resource, so an envelope from
+// one app or service is never compared against another's high-water mark.
+func checkpointKey(row db.RawUsageEvent) string {
+	return checkpointPrefix + ":" + row.Kind + ":" + row.GUID
+}
+
+// checkpointFor returns the high-water mark for key, loading it from the
+// store the first time this run sees that resource and caching it in
+// memory afterwards.
+func (c *Collector) checkpointFor(ctx context.Context, key string) (time.Time, error) {
+	c.mu.Lock()
+	if cp, ok := c.checkpoints[key]; ok && cp.loaded {
+		c.mu.Unlock()
+		return cp.at, nil
+	}
+	c.mu.Unlock()
+
+	at, err := c.store.GetCheckpoint(ctx, key)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cp, ok := c.checkpoints[key]; ok && cp.loaded {
+		// Lost a race with another envelope for the same resource loading
+		// this checkpoint first; its value is authoritative.
+		return cp.at, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	c.checkpoints[key] = resourceCheckpoint{at: at, loaded: true}
+	return at, nil
+}
+
+// setCheckpoint advances key's in-memory high-water mark, ignoring
+// out-of-order envelopes that are older than what's already checkpointed
+// for that resource.
+func (c *Collector) setCheckpoint(key string, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp := c.checkpoints[key]
+	if t.After(cp.at) {
+		cp.at = t
+	}
+	cp.loaded = true
+	c.checkpoints[key] = cp
+}
+
+// convertEnvelope maps the envelope types we bill on into the shared
+// db.RawUsageEvent row shape. Envelopes we don't recognise are ignored.
+func convertEnvelope(envelope *events.Envelope) (db.RawUsageEvent, bool) {
+	switch envelope.GetEventType() {
+	case events.Envelope_ContainerMetric:
+		cm := envelope.GetContainerMetric()
+		return db.RawUsageEvent{
+			GUID:      cm.GetApplicationId(),
+			Kind:      "app",
+			CreatedAt: time.Unix(0, envelope.GetTimestamp()),
+			Raw: map[string]interface{}{
+				"instance_index": cm.GetInstanceIndex(),
+				"cpu_percentage": cm.GetCpuPercentage(),
+				"memory_bytes":   cm.GetMemoryBytes(),
+				"disk_bytes":     cm.GetDiskBytes(),
+			},
+		}, true
+	case events.Envelope_ValueMetric:
+		vm := envelope.GetValueMetric()
+		if envelope.GetOrigin() != "service-broker" {
+			return db.RawUsageEvent{}, false
+		}
+		return db.RawUsageEvent{
+			GUID:      envelope.GetDeployment(),
+			Kind:      "service",
+			CreatedAt: time.Unix(0, envelope.GetTimestamp()),
+			Raw: map[string]interface{}{
+				"name":  vm.GetName(),
+				"value": vm.GetValue(),
+				"unit":  vm.GetUnit(),
+			},
+		}, true
+	default:
+		return db.RawUsageEvent{}, false
+	}
+}
@@ -0,0 +1,33 @@
+package firehose
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config holds the settings needed to run the firehose collector.
+type Config struct {
+	// SubscriptionID groups this process with any other billing instances
+	// using the same value so the firehose nozzle load-balances envelopes
+	// across them rather than fanning every envelope out to every instance.
+	SubscriptionID string
+	// MinBackoff/MaxBackoff bound the exponential backoff used to
+	// reconnect after a websocket error.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// CreateConfigFromEnv builds a Config from FIREHOSE_* environment variables.
+func CreateConfigFromEnv() (Config, error) {
+	subscriptionID := os.Getenv("FIREHOSE_SUBSCRIPTION_ID")
+	if subscriptionID == "" {
+		return Config{}, errors.New("FIREHOSE_SUBSCRIPTION_ID must be set")
+	}
+	return Config{
+		SubscriptionID: subscriptionID,
+		MinBackoff:     1 * time.Second,
+		MaxBackoff:     1 * time.Minute,
+	}, nil
+}
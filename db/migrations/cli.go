@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/pkg/errors"
+)
+
+// Run executes a `paas-billing migrate <subcommand>` invocation against
+// databaseURL. Supported subcommands are up, down, status and
+// `goto <version>`.
+func Run(databaseURL string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: paas-billing migrate up|down|status|goto <version>")
+	}
+
+	m, err := New(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "up":
+		err = m.Up()
+	case "down":
+		err = m.Down()
+	case "status":
+		return printStatus(m)
+	case "goto":
+		if len(args) != 2 {
+			return errors.New("usage: paas-billing migrate goto <version>")
+		}
+		var version uint
+		if _, serr := fmt.Sscanf(args[1], "%d", &version); serr != nil {
+			return errors.Wrap(serr, "invalid version")
+		}
+		err = m.Migrate(version)
+	default:
+		return errors.Errorf("unknown migrate subcommand %q", args[0])
+	}
+
+	if err != nil && err != migrate.ErrNoChange {
+		return err
+	}
+	return nil
+}
+
+func printStatus(m *migrate.Migrate) error {
+	version, dirty, err := m.Version()
+	if err == migrate.ErrNilVersion {
+		fmt.Println("no migrations applied")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("version %d (dirty=%t)\n", version, dirty)
+	return nil
+}
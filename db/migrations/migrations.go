@@ -0,0 +1,87 @@
+// Package migrations manages the Postgres schema as a sequence of
+// numbered, embedded up/down SQL files, replacing the old all-or-nothing
+// db.InitSchema() bootstrap.
+package migrations
+
+import (
+	"embed"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/pkg/errors"
+)
+
+//go:embed sql/*.sql
+var sqlFiles embed.FS
+
+// RequiredVersion is the schema version this build of the binary expects.
+// Bump it whenever a new migration is added.
+const RequiredVersion = 1
+
+// New returns a *migrate.Migrate that reads migrations from the embedded
+// sql directory and applies them against databaseURL.
+func New(databaseURL string) (*migrate.Migrate, error) {
+	source, err := iofs.New(sqlFiles, "sql")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load embedded migrations")
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, databaseURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to initialise migration runner")
+	}
+
+	return m, nil
+}
+
+// Up applies all pending migrations. It treats "nothing to do" as success.
+func Up(databaseURL string) error {
+	m, err := New(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return errors.Wrap(err, "failed to apply migrations")
+	}
+	return nil
+}
+
+// Version returns the currently applied migration version, or 0 if no
+// migrations have been applied yet.
+func Version(databaseURL string) (version uint, dirty bool, err error) {
+	m, err := New(databaseURL)
+	if err != nil {
+		return 0, false, err
+	}
+	defer m.Close()
+
+	version, dirty, err = m.Version()
+	if err == migrate.ErrNilVersion {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrap(err, "failed to read schema version")
+	}
+	return version, dirty, nil
+}
+
+// CheckVersion returns an error unless the database's applied migration
+// version exactly matches RequiredVersion. The view-updater loop in main
+// calls this before each UpdateViews() run so an old binary doesn't touch a schema a newer release has
+// already migrated out from under it, and vice versa.
+func CheckVersion(databaseURL string) error {
+	version, dirty, err := Version(databaseURL)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return errors.Errorf("database schema is dirty at version %d: run `paas-billing migrate status`", version)
+	}
+	if version != RequiredVersion {
+		return errors.Errorf("database schema is at version %d, this binary requires version %d", version, RequiredVersion)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package migrations_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alphagov/paas-billing/db/migrations"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// TestMigrationsRoundTrip spins up a throwaway Postgres in a Docker
+// container, runs every migration up then all the way back down, and
+// asserts the schema round-trips cleanly in both directions.
+func TestMigrationsRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping container-backed test in -short mode")
+	}
+
+	ctx := context.Background()
+
+	container, err := postgres.RunContainer(ctx,
+		testcontainers.WithImage("postgres:14-alpine"),
+		postgres.WithDatabase("paas_billing_test"),
+		postgres.WithUsername("paas_billing"),
+		postgres.WithPassword("paas_billing"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(30*time.Second)),
+	)
+	if err != nil {
+		t.Fatalf("start postgres container: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(ctx); err != nil {
+			t.Logf("terminate postgres container: %s", err)
+		}
+	})
+
+	databaseURL, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatalf("connection string: %s", err)
+	}
+
+	if err := migrations.Up(databaseURL); err != nil {
+		t.Fatalf("migrate up: %s", err)
+	}
+
+	version, dirty, err := migrations.Version(databaseURL)
+	if err != nil {
+		t.Fatalf("version: %s", err)
+	}
+	if dirty {
+		t.Fatalf("schema left dirty at version %d", version)
+	}
+	if version != migrations.RequiredVersion {
+		t.Fatalf("expected version %d, got %d", migrations.RequiredVersion, version)
+	}
+
+	m, err := migrations.New(databaseURL)
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	defer m.Close()
+
+	if err := m.Down(); err != nil {
+		t.Fatalf("migrate down: %s", err)
+	}
+
+	version, _, err = migrations.Version(databaseURL)
+	if err != nil {
+		t.Fatalf("version after down: %s", err)
+	}
+	if version != 0 {
+		t.Fatalf("expected version 0 after down, got %d", version)
+	}
+}
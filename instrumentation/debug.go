@@ -0,0 +1,77 @@
+package instrumentation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// ListenAndServeDebug starts a debug listener on addr serving net/http/pprof
+// and a /goroutines dump handler (the HTTP equivalent of a SIGQUIT
+// goroutine dump). It blocks until ctx is cancelled or the listener fails,
+// which it logs. It is a no-op if addr
+// is empty, since the endpoint exposes internal process state and
+// shouldn't be bound unless an operator explicitly asks for it.
+func ListenAndServeDebug(ctx context.Context, logger lager.Logger, addr string) {
+	if addr == "" {
+		return
+	}
+	logger = logger.Session("debug-server")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/goroutines", goroutineDumpHandler)
+
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	logger.Info("starting", lager.Data{"addr": addr})
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("listen-and-serve", err)
+	}
+	logger.Info("stopped")
+}
+
+func goroutineDumpHandler(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 1<<20)
+	n := runtime.Stack(buf, true)
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(buf[:n])
+}
+
+// MonitorEventLoop logs a warning via logger whenever more than stallAfter
+// passes without a tick on heartbeat, which usually means the loop it's
+// watching has wedged.
+func MonitorEventLoop(ctx context.Context, logger lager.Logger, name string, stallAfter time.Duration, heartbeat <-chan struct{}) {
+	logger = logger.Session("uptime-monitor", lager.Data{"loop": name})
+	timer := time.NewTimer(stallAfter)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(stallAfter)
+		case <-timer.C:
+			logger.Error("stalled", errors.New("no heartbeat received within stall threshold"), lager.Data{"stall_after": stallAfter.String()})
+			timer.Reset(stallAfter)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Package instrumentation exports the Prometheus metrics paas-billing
+// records about its own operation: how often the collectors run, how many
+// events they've written, how long database writes and the hourly view
+// refresh take, how often the firehose reconnects, and whether this
+// replica holds the HA lock.
+package instrumentation
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// CollectorIterations counts how many times each named collector has
+	// run its poll (or firehose subscribe) loop.
+	CollectorIterations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "paas_billing",
+		Subsystem: "collector",
+		Name:      "iterations_total",
+		Help:      "Number of collector iterations, labelled by collector name.",
+	}, []string{"collector"})
+
+	// EventsFetched counts usage events written to the database, labelled
+	// by the collector that wrote them.
+	EventsFetched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "paas_billing",
+		Subsystem: "collector",
+		Name:      "events_fetched_total",
+		Help:      "Number of usage events fetched, labelled by collector name.",
+	}, []string{"collector"})
+
+	// DBWriteLatency records how long database writes take, labelled by
+	// operation.
+	DBWriteLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "paas_billing",
+		Subsystem: "db",
+		Name:      "write_latency_seconds",
+		Help:      "Latency of database writes, labelled by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// ViewRefreshDuration records how long each UpdateViews() run takes.
+	ViewRefreshDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "paas_billing",
+		Subsystem: "views",
+		Name:      "refresh_duration_seconds",
+		Help:      "How long UpdateViews() took to run.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	// FirehoseReconnects counts how many times the firehose collector has
+	// had to reconnect after a websocket error.
+	FirehoseReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "paas_billing",
+		Subsystem: "firehose",
+		Name:      "reconnects_total",
+		Help:      "Number of times the firehose collector has had to reconnect.",
+	})
+
+	// LockHeld is 1 while this replica holds the billing lock, 0
+	// otherwise.
+	LockHeld = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "paas_billing",
+		Subsystem: "lock",
+		Name:      "held",
+		Help:      "1 if this replica currently holds the billing lock, 0 otherwise.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		CollectorIterations,
+		EventsFetched,
+		DBWriteLatency,
+		ViewRefreshDuration,
+		FirehoseReconnects,
+		LockHeld,
+	)
+}
+
+// ObserveDBWrite runs fn and records how long it took under operation,
+// returning fn's error unchanged.
+func ObserveDBWrite(operation string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	DBWriteLatency.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	return err
+}
@@ -0,0 +1,45 @@
+package lock
+
+import (
+	"hash/fnv"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config controls which advisory lock a replica contends for and how often
+// it renews its hold on it.
+type Config struct {
+	// Key is the int64 that Postgres advisory locks require, hashed (FNV-1a)
+	// from the raw string operators set via BILLING_LOCK_KEY.
+	Key int64
+	// HeartbeatInterval is how often the lock holder confirms its session
+	// is still alive. RenewTimeout is how long each heartbeat query may
+	// take; the first heartbeat that fails or runs past it makes the
+	// holder give up the lock and fail fast.
+	HeartbeatInterval time.Duration
+	RenewTimeout      time.Duration
+}
+
+const defaultLockKey = "paas-billing"
+
+// CreateConfigFromEnv builds a Config from BILLING_LOCK_KEY. All replicas
+// that should elect a single leader must be configured with the same key.
+func CreateConfigFromEnv() (Config, error) {
+	rawKey := os.Getenv("BILLING_LOCK_KEY")
+	if rawKey == "" {
+		rawKey = defaultLockKey
+	}
+
+	h := fnv.New64a()
+	if _, err := h.Write([]byte(rawKey)); err != nil {
+		return Config{}, errors.Wrap(err, "failed to hash BILLING_LOCK_KEY")
+	}
+
+	return Config{
+		Key:               int64(h.Sum64()),
+		HeartbeatInterval: 15 * time.Second,
+		RenewTimeout:      45 * time.Second,
+	}, nil
+}
@@ -0,0 +1,159 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+	"github.com/alphagov/paas-billing/instrumentation"
+	"github.com/pkg/errors"
+)
+
+// PostgresLock is an ifrit.Runner that holds a single Postgres session-level
+// advisory lock for as long as it runs. Postgres is already a dependency of
+// paas-billing, so this avoids pulling in Consul or another coordination
+// service just for leader election.
+//
+// It blocks acquiring the lock in Run, then renews it on a timer by pinging
+// the pinned connection; if the connection is lost or a ping doesn't land
+// within RenewTimeout it fails fast, causing the ordered runner group above
+// it to tear down the collectors and view-updater it gates.
+type PostgresLock struct {
+	db     *sql.DB
+	config Config
+	logger lager.Logger
+
+	mu     sync.RWMutex
+	held   bool
+	holder string
+}
+
+// NewPostgresLock returns a PostgresLock keyed by config.Key.
+func NewPostgresLock(db *sql.DB, config Config, logger lager.Logger) *PostgresLock {
+	return &PostgresLock{
+		db:     db,
+		config: config,
+		logger: logger.Session("postgres-lock"),
+	}
+}
+
+// Run implements ifrit.Runner. It blocks until the advisory lock is
+// acquired, signals ready, then renews the lock until signalled to stop or
+// the renewal fails. A replica that is signalled while still waiting to
+// acquire the lock (the common case for every standby) cancels the wait
+// and returns immediately instead of hanging until it becomes leader.
+func (l *PostgresLock) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	conn, err := l.db.Conn(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "failed to open lock connection")
+	}
+	defer conn.Close()
+
+	acquireCtx, cancelAcquire := context.WithCancel(context.Background())
+	defer cancelAcquire()
+
+	l.logger.Info("acquiring")
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := conn.ExecContext(acquireCtx, "SELECT pg_advisory_lock($1)", l.config.Key)
+		acquired <- err
+	}()
+
+	select {
+	case <-signals:
+		l.logger.Info("stopped-waiting-for-lock")
+		cancelAcquire()
+		return nil
+	case err := <-acquired:
+		if err != nil {
+			return errors.Wrap(err, "failed to acquire advisory lock")
+		}
+	}
+	l.logger.Info("acquired")
+
+	hostname, _ := os.Hostname()
+	l.setHeld(true, hostname)
+	defer l.setHeld(false, "")
+	defer l.release(conn)
+
+	close(ready)
+
+	ticker := time.NewTicker(l.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-signals:
+			l.logger.Info("releasing")
+			return nil
+		case <-ticker.C:
+			heartbeatCtx, cancel := context.WithTimeout(context.Background(), l.config.RenewTimeout)
+			_, err := conn.ExecContext(heartbeatCtx, "SELECT 1")
+			cancel()
+			if err != nil {
+				return errors.Wrap(err, "lock heartbeat failed")
+			}
+		}
+	}
+}
+
+// release unlocks the advisory lock and discards the physical connection
+// instead of returning it to the pool. pg_advisory_lock is session-level,
+// so a heartbeat that fails on the client side (e.g. a query that simply
+// doesn't land within RenewTimeout) doesn't necessarily mean the
+// underlying connection died — (*sql.Conn).Close alone would hand it back
+// to the pool still holding the lock, where nothing could ever release it
+// again. Forcing driver.ErrBadConn makes the pool discard the connection
+// unconditionally.
+func (l *PostgresLock) release(conn *sql.Conn) {
+	releaseCtx, cancel := context.WithTimeout(context.Background(), l.config.RenewTimeout)
+	defer cancel()
+	if _, err := conn.ExecContext(releaseCtx, "SELECT pg_advisory_unlock($1)", l.config.Key); err != nil {
+		l.logger.Error("release-failed", err)
+	}
+	if err := conn.Raw(func(driverConn interface{}) error {
+		return driver.ErrBadConn
+	}); err != nil && err != driver.ErrBadConn {
+		l.logger.Error("discard-connection-failed", err)
+	}
+}
+
+func (l *PostgresLock) setHeld(held bool, holder string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = held
+	l.holder = holder
+
+	if held {
+		instrumentation.LockHeld.Set(1)
+	} else {
+		instrumentation.LockHeld.Set(0)
+	}
+}
+
+// Status reports whether this process currently holds the lock and, if so,
+// the hostname it acquired it as.
+func (l *PostgresLock) Status() (held bool, holder string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.held, l.holder
+}
+
+// Handler serves the current lock status as JSON so operators can tell
+// which replica is the active leader.
+func (l *PostgresLock) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		held, holder := l.Status()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Held   bool   `json:"held"`
+			Holder string `json:"holder,omitempty"`
+		}{Held: held, Holder: holder})
+	})
+}
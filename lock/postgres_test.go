@@ -0,0 +1,189 @@
+package lock_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"github.com/alphagov/paas-billing/lock"
+	_ "github.com/lib/pq"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// startPostgres spins up a throwaway Postgres and returns a *sql.DB
+// pointed at it, closing both when the test ends.
+func startPostgres(t *testing.T) (context.Context, *sql.DB) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping container-backed test in -short mode")
+	}
+
+	ctx := context.Background()
+
+	container, err := postgres.RunContainer(ctx,
+		testcontainers.WithImage("postgres:14-alpine"),
+		postgres.WithDatabase("paas_billing_test"),
+		postgres.WithUsername("paas_billing"),
+		postgres.WithPassword("paas_billing"),
+		testcontainers.WithWaitStrategy(
+			wait.ForLog("database system is ready to accept connections").
+				WithOccurrence(2).
+				WithStartupTimeout(30*time.Second)),
+	)
+	if err != nil {
+		t.Fatalf("start postgres container: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(ctx); err != nil {
+			t.Logf("terminate postgres container: %s", err)
+		}
+	})
+
+	databaseURL, err := container.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		t.Fatalf("connection string: %s", err)
+	}
+
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		t.Fatalf("open db: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return ctx, db
+}
+
+// tryAdvisoryLock reports whether key is currently free, taking and
+// immediately releasing it if so.
+func tryAdvisoryLock(ctx context.Context, t *testing.T, db *sql.DB, key int64) bool {
+	t.Helper()
+
+	var acquired bool
+	if err := db.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired); err != nil {
+		t.Fatalf("try advisory lock: %s", err)
+	}
+	if acquired {
+		if _, err := db.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key); err != nil {
+			t.Fatalf("unlock advisory lock: %s", err)
+		}
+	}
+	return acquired
+}
+
+func TestPostgresLock_CancelsAcquireWhenSignalledFirst(t *testing.T) {
+	_, db := startPostgres(t)
+
+	cfg := lock.Config{Key: 1, HeartbeatInterval: 10 * time.Millisecond, RenewTimeout: time.Second}
+	logger := lagertest.NewTestLogger("postgres-lock-test")
+
+	holder := lock.NewPostgresLock(db, cfg, logger)
+	holderReady := make(chan struct{})
+	holderSignals := make(chan os.Signal, 1)
+	holderDone := make(chan error, 1)
+	go func() { holderDone <- holder.Run(holderSignals, holderReady) }()
+
+	select {
+	case <-holderReady:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for holder to acquire the lock")
+	}
+	defer func() {
+		holderSignals <- os.Interrupt
+		<-holderDone
+	}()
+
+	waiter := lock.NewPostgresLock(db, cfg, logger)
+	waiterReady := make(chan struct{})
+	waiterSignals := make(chan os.Signal, 1)
+	waiterDone := make(chan error, 1)
+	go func() { waiterDone <- waiter.Run(waiterSignals, waiterReady) }()
+
+	// Give the waiter time to actually be blocked in pg_advisory_lock
+	// before signalling it, rather than racing its own startup.
+	time.Sleep(100 * time.Millisecond)
+	waiterSignals <- os.Interrupt
+
+	select {
+	case err := <-waiterDone:
+		if err != nil {
+			t.Fatalf("waiter.Run returned an error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter did not stop within 5s of being signalled while still waiting for the lock")
+	}
+}
+
+func TestPostgresLock_ReleasesOnSignal(t *testing.T) {
+	ctx, db := startPostgres(t)
+
+	cfg := lock.Config{Key: 2, HeartbeatInterval: 10 * time.Millisecond, RenewTimeout: time.Second}
+	l := lock.NewPostgresLock(db, cfg, lagertest.NewTestLogger("postgres-lock-test"))
+
+	ready := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- l.Run(signals, ready) }()
+
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for lock acquisition")
+	}
+
+	signals <- os.Interrupt
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run returned an error on signalled shutdown: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return within 5s of being signalled")
+	}
+
+	if !tryAdvisoryLock(ctx, t, db, cfg.Key) {
+		t.Fatal("advisory lock still held after Run returned on signal")
+	}
+}
+
+// TestPostgresLock_ReleasesOnHeartbeatFailure guards against a lock leak:
+// a RenewTimeout so short every heartbeat query is cancelled client-side
+// before it can land, even though the underlying connection is otherwise
+// perfectly healthy. Run must still give up the advisory lock (by
+// discarding the connection) rather than leaving it held by a connection
+// sitting healthy in the pool that nothing can ever unlock again.
+func TestPostgresLock_ReleasesOnHeartbeatFailure(t *testing.T) {
+	ctx, db := startPostgres(t)
+
+	cfg := lock.Config{Key: 3, HeartbeatInterval: 10 * time.Millisecond, RenewTimeout: time.Nanosecond}
+	l := lock.NewPostgresLock(db, cfg, lagertest.NewTestLogger("postgres-lock-test"))
+
+	ready := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- l.Run(signals, ready) }()
+
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for lock acquisition")
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected Run to return an error after a heartbeat timeout, got nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not exit within 5s of its heartbeat starting to fail")
+	}
+
+	if !tryAdvisoryLock(ctx, t, db, cfg.Key) {
+		t.Fatal("advisory lock still held after Run exited on heartbeat failure")
+	}
+}
@@ -15,11 +15,41 @@ import (
 	"github.com/alphagov/paas-billing/cloudfoundry"
 	"github.com/alphagov/paas-billing/collector"
 	collector_cf "github.com/alphagov/paas-billing/collector/cloudfoundry"
+	"github.com/alphagov/paas-billing/collector/firehose"
 	"github.com/alphagov/paas-billing/db"
+	"github.com/alphagov/paas-billing/db/migrations"
+	"github.com/alphagov/paas-billing/instrumentation"
+	"github.com/alphagov/paas-billing/lock"
 	"github.com/alphagov/paas-billing/server"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/grouper"
 )
 
+// collectorMode controls which of the polling and firehose collectors are
+// started, so operators can migrate from one to the other gradually.
+type collectorMode string
+
+const (
+	collectorModePolling  collectorMode = "polling"
+	collectorModeFirehose collectorMode = "firehose"
+	collectorModeBoth     collectorMode = "both"
+)
+
+func createCollectorModeFromEnv() (collectorMode, error) {
+	mode := collectorMode(strings.ToLower(os.Getenv("COLLECTOR_MODE")))
+	if mode == "" {
+		mode = collectorModePolling
+	}
+	switch mode {
+	case collectorModePolling, collectorModeFirehose, collectorModeBoth:
+		return mode, nil
+	default:
+		return "", errors.Errorf("invalid COLLECTOR_MODE %q: must be polling, firehose or both", mode)
+	}
+}
+
 var (
 	logger = createLogger()
 )
@@ -40,15 +70,45 @@ func createCFClient() (cloudfoundry.Client, error) {
 	return cloudfoundry.NewClient(config)
 }
 
+// runnerFunc adapts a ctx-cancellable background loop (the shape all of our
+// collectors and the view updater already use) into an ifrit.Runner, so it
+// can take its place in the ordered, lock-gated group below.
+func runnerFunc(name string, run func(ctx context.Context)) ifrit.Runner {
+	return ifrit.RunFunc(func(signals <-chan os.Signal, ready chan<- struct{}) error {
+		runCtx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			run(runCtx)
+		}()
+
+		close(ready)
+
+		select {
+		case <-signals:
+			logger.Info("stopping", lager.Data{"member": name})
+			cancel()
+			<-done
+			return nil
+		case <-done:
+			return nil
+		}
+	})
+}
+
 func Main() error {
 
-	sqlClient, err := db.NewPostgresClient(os.Getenv("DATABASE_URL"))
+	databaseURL := os.Getenv("DATABASE_URL")
+
+	sqlClient, err := db.NewPostgresClient(databaseURL)
 	if err != nil {
 		return err
 	}
 
-	if err := sqlClient.InitSchema(); err != nil {
-		return errors.Wrap(err, "failed to initialise database schema")
+	if err := migrations.Up(databaseURL); err != nil {
+		return errors.Wrap(err, "failed to migrate database schema")
 	}
 
 	cfClient, clientErr := createCFClient()
@@ -61,6 +121,24 @@ func Main() error {
 		return errors.Wrap(err, "configuration error")
 	}
 
+	mode, err := createCollectorModeFromEnv()
+	if err != nil {
+		return errors.Wrap(err, "configuration error")
+	}
+
+	var firehoseConfig firehose.Config
+	if mode == collectorModeFirehose || mode == collectorModeBoth {
+		firehoseConfig, err = firehose.CreateConfigFromEnv()
+		if err != nil {
+			return errors.Wrap(err, "configuration error")
+		}
+	}
+
+	lockConfig, err := lock.CreateConfigFromEnv()
+	if err != nil {
+		return errors.Wrap(err, "configuration error")
+	}
+
 	uaaConfig, err := auth.CreateConfigFromEnv()
 	if err != nil {
 		return err
@@ -81,49 +159,143 @@ func Main() error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		defer shutdown()
+		instrumentation.ListenAndServeDebug(ctx, logger, os.Getenv("DEBUG_ADDR"))
+	}()
+
+	// The lock-maintainer, collectors and view-updater are run as an
+	// ordered group behind the advisory lock: grouper won't start a member
+	// until the previous one signals ready, so nothing here runs until
+	// lock-maintainer has actually acquired the lock. If the lock is lost,
+	// lock-maintainer exits and grouper tears the rest of the group down
+	// with it, so we never double-insert events or double-run
+	// UpdateViews() across replicas. The API server is deliberately kept
+	// outside this group so reads keep working on every replica.
+	pgLock := lock.NewPostgresLock(sqlClient.DB(), lockConfig, logger)
 
-		appUsageEventsCollector := collector.New(
-			collectorConfig,
-			logger,
-			collector_cf.NewEventFetcher(
-				sqlClient,
-				cloudfoundry.NewAppUsageEventsAPI(cfClient, logger),
-			),
+	members := grouper.Members{
+		{Name: "lock-maintainer", Runner: pgLock},
+	}
+
+	if mode == collectorModePolling || mode == collectorModeBoth {
+		members = append(members,
+			grouper.Member{
+				Name: "app-usage-collector",
+				Runner: runnerFunc("app-usage-collector", func(ctx context.Context) {
+					collector.New(
+						collectorConfig,
+						logger,
+						collector_cf.NewEventFetcher(
+							sqlClient,
+							cloudfoundry.NewAppUsageEventsAPI(cfClient, logger),
+						),
+					).Run(ctx)
+				}),
+			},
+			grouper.Member{
+				Name: "service-usage-collector",
+				Runner: runnerFunc("service-usage-collector", func(ctx context.Context) {
+					collector.New(
+						collectorConfig,
+						logger,
+						collector_cf.NewEventFetcher(
+							sqlClient,
+							cloudfoundry.NewServiceUsageEventsAPI(cfClient, logger),
+						),
+					).Run(ctx)
+				}),
+			},
 		)
-		appUsageEventsCollector.Run(ctx)
-	}()
+	}
+
+	if mode == collectorModeFirehose || mode == collectorModeBoth {
+		members = append(members, grouper.Member{
+			Name: "firehose-collector",
+			Runner: runnerFunc("firehose-collector", func(ctx context.Context) {
+				firehoseCollector := firehose.New(
+					firehoseConfig,
+					logger,
+					cloudfoundry.NewFirehoseClient(cfClient, logger),
+					sqlClient,
+				)
+				if err := firehoseCollector.Run(ctx); err != nil {
+					logger.Error("firehose-collector", err)
+				}
+			}),
+		})
+	}
+
+	viewUpdaterHeartbeat := make(chan struct{}, 1)
+	members = append(members, grouper.Member{
+		Name: "view-updater",
+		Runner: runnerFunc("view-updater", func(ctx context.Context) {
+			logger.Info("starting view updater")
+			defer logger.Info("stopped view updater")
+			for {
+				select {
+				case viewUpdaterHeartbeat <- struct{}{}:
+				default:
+				}
+
+				if err := migrations.CheckVersion(databaseURL); err != nil {
+					logger.Error("update-views", errors.Wrap(err, "skipping this tick"))
+				} else {
+					logger.Info("updating views")
+					start := time.Now()
+					err := sqlClient.UpdateViews()
+					instrumentation.ViewRefreshDuration.Observe(time.Since(start).Seconds())
+					if err != nil {
+						logger.Error("update-views", err)
+					}
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(1 * time.Hour):
+				}
+			}
+		}),
+	})
 
+	stallAfter := 2 * time.Hour
+	if raw := os.Getenv("UPTIME_STALL_SECONDS"); raw != "" {
+		if seconds, err := time.ParseDuration(raw + "s"); err == nil {
+			stallAfter = seconds
+		}
+	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		defer shutdown()
-
-		serviceUsageEventsCollector := collector.New(
-			collectorConfig,
-			logger,
-			collector_cf.NewEventFetcher(
-				sqlClient,
-				cloudfoundry.NewServiceUsageEventsAPI(cfClient, logger),
-			),
-		)
-		serviceUsageEventsCollector.Run(ctx)
+		instrumentation.MonitorEventLoop(ctx, logger, "view-updater", stallAfter, viewUpdaterHeartbeat)
 	}()
 
+	electedGroup := grouper.NewOrdered(os.Interrupt, members)
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		defer logger.Info("stopped view updater")
-		logger.Info("starting view updater")
+		defer shutdown()
+
 		for {
-			logger.Info("updating views")
-			if err := sqlClient.UpdateViews(); err != nil {
-				logger.Error("update-views", err)
-			}
+			process := ifrit.Background(electedGroup)
 			select {
 			case <-ctx.Done():
+				process.Signal(os.Interrupt)
+				<-process.Wait()
 				return
-			case <-time.After(1 * time.Hour):
+			case err := <-process.Wait():
+				if err != nil {
+					logger.Error("elected-group-exited", err)
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				// Lost the lock (or failed to acquire it): back off and
+				// try again so another replica gets a chance to lead.
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(lockConfig.HeartbeatInterval):
+				}
 			}
 		}
 	}()
@@ -133,12 +305,14 @@ func Main() error {
 		defer wg.Done()
 		defer logger.Info("stopped api server")
 		logger.Info("starting api server")
-		s := server.New(sqlClient, apiAuthenticator, cfClient)
+		mux := server.New(sqlClient, apiAuthenticator, cfClient)
+		mux.Handle("/lock", pgLock.Handler())
+		mux.Handle("/metrics", promhttp.Handler())
 		port := os.Getenv("PORT")
 		if port == "" {
 			port = "8881"
 		}
-		server.ListenAndServe(ctx, s, fmt.Sprintf(":%s", port))
+		server.ListenAndServe(ctx, mux, fmt.Sprintf(":%s", port))
 	}()
 
 	wg.Wait()
@@ -146,6 +320,14 @@ func Main() error {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrations.Run(os.Getenv("DATABASE_URL"), os.Args[2:]); err != nil {
+			logger.Error("migrate", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if err := Main(); err != nil {
 		logger.Error("main", err)
 		os.Exit(1)
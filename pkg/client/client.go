@@ -0,0 +1,107 @@
+// Package client is a thin, typed wrapper over the paas-billing HTTP API
+// described by api/openapi.yaml, for downstream Go consumers that don't
+// want to hand-roll requests against server.ServerInterface's routes.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alphagov/paas-billing/server"
+	"github.com/pkg/errors"
+)
+
+// Client calls the paas-billing API at BaseURL, authenticating with an
+// AccessToken obtained from UAA the same way the API itself validates it.
+type Client struct {
+	BaseURL     string
+	AccessToken string
+	HTTPClient  *http.Client
+}
+
+// New returns a Client for baseURL, defaulting HTTPClient to
+// http.DefaultClient if httpClient is nil.
+func New(baseURL, accessToken string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{BaseURL: baseURL, AccessToken: accessToken, HTTPClient: httpClient}
+}
+
+// GetReport calls GET /report/{rangeGuid}.
+func (c *Client) GetReport(ctx context.Context, rangeGuid string, from, to time.Time) ([]server.BillableEvent, error) {
+	var events []server.BillableEvent
+	path := fmt.Sprintf("/report/%s", url.PathEscape(rangeGuid))
+	if err := c.get(ctx, path, from, to, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetUsage calls GET /usage/{rangeGuid}.
+func (c *Client) GetUsage(ctx context.Context, rangeGuid string, from, to time.Time) ([]server.UsageEvent, error) {
+	var events []server.UsageEvent
+	path := fmt.Sprintf("/usage/%s", url.PathEscape(rangeGuid))
+	if err := c.get(ctx, path, from, to, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// GetPricingPlans calls GET /pricing_plans.
+func (c *Client) GetPricingPlans(ctx context.Context) ([]server.PricingPlan, error) {
+	var plans []server.PricingPlan
+	if err := c.do(ctx, "/pricing_plans", nil, &plans); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// GetForecastEvents calls GET /forecast_events.
+func (c *Client) GetForecastEvents(ctx context.Context, from, to time.Time) ([]server.BillableEvent, error) {
+	var events []server.BillableEvent
+	if err := c.get(ctx, "/forecast_events", from, to, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, from, to time.Time, out interface{}) error {
+	query := url.Values{
+		"from": {from.Format(time.RFC3339)},
+		"to":   {to.Format(time.RFC3339)},
+	}
+	return c.do(ctx, path, query, out)
+}
+
+func (c *Client) do(ctx context.Context, path string, query url.Values, out interface{}) error {
+	u := c.BaseURL + path
+	if query != nil {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to build request")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "request failed")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status %d from %s", res.StatusCode, path)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return errors.Wrap(err, "failed to decode response")
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubServer is a minimal ServerInterface that just reports which
+// operation it was called with, so api_test.go can assert requests
+// actually reach a handler instead of only checking what got registered.
+type stubServer struct {
+	called string
+}
+
+func (s *stubServer) GetReport(w http.ResponseWriter, r *http.Request, rangeGuid string, params GetReportParams) {
+	s.called = "getReport"
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *stubServer) GetUsage(w http.ResponseWriter, r *http.Request, rangeGuid string, params GetUsageParams) {
+	s.called = "getUsage"
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *stubServer) GetPricingPlans(w http.ResponseWriter, r *http.Request) {
+	s.called = "getPricingPlans"
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *stubServer) GetForecastEvents(w http.ResponseWriter, r *http.Request, params GetForecastEventsParams) {
+	s.called = "getForecastEvents"
+	w.WriteHeader(http.StatusOK)
+}
+
+// TestRegisterHandlersValidatesAndDelegates exercises the real mux built by
+// RegisterHandlers end to end, guarding against the validator rejecting
+// every request outright (it did: ValidateRequest requires
+// Options.AuthenticationFunc whenever the spec declares a security
+// requirement, and newSpecValidator wasn't setting it) as well as against
+// it validating nothing at all.
+func TestRegisterHandlersValidatesAndDelegates(t *testing.T) {
+	si := &stubServer{}
+	mux, err := RegisterHandlers(http.NewServeMux(), si)
+	if err != nil {
+		t.Fatalf("RegisterHandlers: %s", err)
+	}
+
+	t.Run("well-formed request reaches the handler", func(t *testing.T) {
+		si.called = ""
+		req := httptest.NewRequest(http.MethodGet, "/report/11111111-1111-1111-1111-111111111111?from=2024-01-01T00:00:00Z&to=2024-01-02T00:00:00Z", nil)
+		rec := httptest.NewRecorder()
+
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if si.called != "getReport" {
+			t.Fatalf("expected GetReport to be called, got %q", si.called)
+		}
+	})
+
+	t.Run("missing required query parameter is rejected before the handler runs", func(t *testing.T) {
+		si.called = ""
+		req := httptest.NewRequest(http.MethodGet, "/report/11111111-1111-1111-1111-111111111111?from=2024-01-01T00:00:00Z", nil)
+		rec := httptest.NewRecorder()
+
+		mux.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if si.called != "" {
+			t.Fatalf("expected the handler not to run, but %q was called", si.called)
+		}
+	})
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ListenAndServe serves handler on addr until ctx is cancelled, then shuts
+// down gracefully.
+func ListenAndServe(ctx context.Context, handler http.Handler, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: handler}
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownErr <- srv.Shutdown(context.Background())
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-shutdownErr
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"testing"
+)
+
+// TestRoutesMatchSpec fails if api/openapi.yaml gains, loses or renames an
+// operation without server/api.go's routes table being updated to match.
+// It checks the same routes table RegisterHandlers uses to build the real
+// mux, not a second hand-typed copy of it.
+func TestRoutesMatchSpec(t *testing.T) {
+	doc, err := GetSwagger()
+	if err != nil {
+		t.Fatalf("load spec: %s", err)
+	}
+
+	type routeKey struct {
+		Method      string
+		Path        string
+		OperationID string
+	}
+
+	var specDefined []routeKey
+	for path, item := range doc.Paths.Map() {
+		for method, op := range item.Operations() {
+			if method != http.MethodGet {
+				t.Fatalf("unsupported method %s %s in spec: server/api.go only knows how to route GET handlers", method, path)
+			}
+			specDefined = append(specDefined, routeKey{Method: method, Path: path, OperationID: op.OperationID})
+		}
+	}
+
+	var registered []routeKey
+	for _, r := range routes {
+		registered = append(registered, routeKey{Method: r.Method, Path: r.Path, OperationID: r.OperationID})
+	}
+
+	sortRoutes := func(keys []routeKey) {
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].Path < keys[j].Path
+		})
+	}
+	sortRoutes(specDefined)
+	sortRoutes(registered)
+
+	if len(specDefined) != len(registered) {
+		t.Fatalf("api/openapi.yaml defines %d operations but server/api.go registers %d", len(specDefined), len(registered))
+	}
+	for i := range specDefined {
+		if specDefined[i] != registered[i] {
+			t.Fatalf("route drift at index %d: spec has %+v, server/api.go registers %+v", i, specDefined[i], registered[i])
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package server implements the HTTP API described by api/openapi.yaml.
+// Run `go generate ./...` after editing the spec to refresh
+// server/openapi.yaml, then update server/api.go's routes table by hand
+// to match; openapi_routes_test.go fails CI if the two drift.
+package server
+
+//go:generate cp ../api/openapi.yaml openapi.yaml
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/alphagov/paas-billing/cloudfoundry"
+	"github.com/alphagov/paas-billing/db"
+)
+
+// Authenticator validates the bearer token api/openapi.yaml's bearerAuth
+// scheme requires on every route. auth.UAA implements it.
+type Authenticator interface {
+	CheckToken(token string) error
+}
+
+// Server implements ServerInterface against a db.SQLClient, authenticating
+// every request with the configured UAA authenticator.
+type Server struct {
+	sqlClient        db.SQLClient
+	apiAuthenticator Authenticator
+	cfClient         cloudfoundry.Client
+}
+
+// New builds the API mux: every route in api/openapi.yaml is registered
+// and validated against that spec before reaching s.
+func New(sqlClient db.SQLClient, apiAuthenticator Authenticator, cfClient cloudfoundry.Client) *http.ServeMux {
+	s := &Server{
+		sqlClient:        sqlClient,
+		apiAuthenticator: apiAuthenticator,
+		cfClient:         cfClient,
+	}
+
+	mux := http.NewServeMux()
+	if _, err := RegisterHandlers(mux, s); err != nil {
+		panic(err)
+	}
+	return mux
+}
+
+func (s *Server) authenticate(r *http.Request) error {
+	return s.apiAuthenticator.CheckToken(r.Header.Get("Authorization"))
+}
+
+func (s *Server) GetReport(w http.ResponseWriter, r *http.Request, rangeGuid string, params GetReportParams) {
+	if err := s.authenticate(r); err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	events, err := s.sqlClient.GetBillableEvents(r.Context(), rangeGuid, params.From, params.To)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, events)
+}
+
+func (s *Server) GetUsage(w http.ResponseWriter, r *http.Request, rangeGuid string, params GetUsageParams) {
+	if err := s.authenticate(r); err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	events, err := s.sqlClient.GetUsageEvents(r.Context(), rangeGuid, params.From, params.To)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, events)
+}
+
+func (s *Server) GetPricingPlans(w http.ResponseWriter, r *http.Request) {
+	if err := s.authenticate(r); err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	plans, err := s.sqlClient.GetPricingPlans(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, plans)
+}
+
+func (s *Server) GetForecastEvents(w http.ResponseWriter, r *http.Request, params GetForecastEventsParams) {
+	if err := s.authenticate(r); err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	events, err := s.sqlClient.GetForecastEvents(r.Context(), params.From, params.To)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, events)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	legacyrouter "github.com/getkin/kin-openapi/routers/legacy"
+)
+
+//go:embed openapi.yaml
+var embeddedSpec []byte
+
+// GetSwagger loads and validates the OpenAPI document api.go's routes are
+// kept in sync with. It's embedded here (a copy of api/openapi.yaml, kept
+// in sync by `go generate`) so the validation middleware doesn't need a
+// filesystem path at runtime.
+func GetSwagger() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(embeddedSpec)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// specValidator rejects a request (writing the response itself and
+// returning false) if it doesn't match the embedded spec: unknown query
+// params, wrong types and missing required fields all become 400s before
+// a ServerInterface method ever runs.
+type specValidator func(w http.ResponseWriter, r *http.Request) bool
+
+// newSpecValidator builds a specValidator from the embedded spec.
+func newSpecValidator() (specValidator, error) {
+	doc, err := GetSwagger()
+	if err != nil {
+		return nil, err
+	}
+	router, err := legacyrouter.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) bool {
+		route, pathParams, err := router.FindRoute(r)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return false
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				// api/openapi.yaml declares a global bearerAuth security
+				// requirement, so ValidateRequest always checks it unless
+				// told not to bother. Server.authenticate does the real
+				// bearer-token check once the request reaches si, so this
+				// validator only needs to check shape (params, schema),
+				// not auth.
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return false
+		}
+
+		// ValidateRequest ignores query params the operation doesn't
+		// declare, so undeclared ones are rejected here.
+		declared := make(map[string]bool)
+		for _, p := range route.Operation.Parameters {
+			if p.Value != nil && p.Value.In == openapi3.ParameterInQuery {
+				declared[p.Value.Name] = true
+			}
+		}
+		for name := range r.URL.Query() {
+			if !declared[name] {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("unknown query parameter %q", name))
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}